@@ -0,0 +1,156 @@
+package strava
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Error implements error so the *StravaAPIError that ExchangeToken and
+// Authorize return can carry it in place of a bare
+// errors.New("Strava API error"). Use errors.Is
+// against the Err* sentinels below for broad handling, or errors.As against
+// StravaErrorResponse for the raw field/code/resource detail.
+//
+// Deauthorize and the other authenticated calls in this package (e.g.
+// SubscriptionsService) go through Client.run, which lives in client.go.
+// client.go is not part of this change: wiring it to return StravaAPIError
+// is a follow-up against that file, not something this request touches.
+func (e StravaErrorResponse) Error() string {
+	if len(e.Errors) == 0 {
+		if e.Message != "" {
+			return fmt.Sprintf("strava: %s", e.Message)
+		}
+		return "strava: api error"
+	}
+
+	parts := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		parts[i] = fmt.Sprintf("%s %s %s", fe.Resource, fe.Field, fe.Code)
+	}
+
+	if e.Message == "" {
+		return fmt.Sprintf("strava: %s", strings.Join(parts, ", "))
+	}
+	return fmt.Sprintf("strava: %s: %s", e.Message, strings.Join(parts, ", "))
+}
+
+// Sentinel errors classified from a StravaErrorResponse by status code and
+// the first error's resource/code pair. Check for these with errors.Is.
+var (
+	ErrInvalidCode        = errors.New("strava: authorization code is invalid or has already been used")
+	ErrInvalidCredentials = errors.New("strava: client_id or client_secret is invalid")
+	ErrRateLimited        = errors.New("strava: rate limited")
+	ErrTokenExpired       = errors.New("strava: access token is expired")
+	ErrInsufficientScope  = errors.New("strava: insufficient oauth scope for this request")
+)
+
+// RateLimit reports Strava's short-term (15 minute) and daily API usage, as
+// parsed from the X-RateLimit-Limit / X-RateLimit-Usage response headers.
+type RateLimit struct {
+	ShortTermLimit int
+	ShortTermUsage int
+	DailyLimit     int
+	DailyUsage     int
+}
+
+func parseRateLimit(resp *http.Response) *RateLimit {
+	limit := resp.Header.Get("X-RateLimit-Limit")
+	usage := resp.Header.Get("X-RateLimit-Usage")
+	if limit == "" && usage == "" {
+		return nil
+	}
+
+	rl := &RateLimit{}
+	if parts := strings.SplitN(limit, ",", 2); len(parts) == 2 {
+		rl.ShortTermLimit, _ = strconv.Atoi(strings.TrimSpace(parts[0]))
+		rl.DailyLimit, _ = strconv.Atoi(strings.TrimSpace(parts[1]))
+	}
+	if parts := strings.SplitN(usage, ",", 2); len(parts) == 2 {
+		rl.ShortTermUsage, _ = strconv.Atoi(strings.TrimSpace(parts[0]))
+		rl.DailyUsage, _ = strconv.Atoi(strings.TrimSpace(parts[1]))
+	}
+	return rl
+}
+
+var (
+	lastRateLimitMu sync.RWMutex
+	lastRateLimit   *RateLimit
+)
+
+// LastRateLimit returns the most recently observed X-RateLimit-* usage from
+// any token exchange (ExchangeToken or Authorize), or nil if none has been
+// observed yet. Calls made through Client are not recorded here, and Client
+// has no LastRateLimit method of its own.
+func LastRateLimit() *RateLimit {
+	lastRateLimitMu.RLock()
+	defer lastRateLimitMu.RUnlock()
+	return lastRateLimit
+}
+
+func recordRateLimit(resp *http.Response) {
+	rl := parseRateLimit(resp)
+	if rl == nil {
+		return
+	}
+	lastRateLimitMu.Lock()
+	lastRateLimit = rl
+	lastRateLimitMu.Unlock()
+}
+
+// StravaAPIError wraps a StravaErrorResponse together with the HTTP status
+// code and the rate limit usage observed on the response. Unwrap yields the
+// Err* sentinel matching StatusCode/Response (for errors.Is) and Response
+// itself (for errors.As), so both broad and detailed handling work against
+// the same error value.
+type StravaAPIError struct {
+	StatusCode int
+	Response   StravaErrorResponse
+	RateLimit  *RateLimit
+}
+
+func (e *StravaAPIError) Error() string {
+	return fmt.Sprintf("strava: http %d: %s", e.StatusCode, e.Response.Error())
+}
+
+func (e *StravaAPIError) Unwrap() []error {
+	return []error{classifyStravaError(e.StatusCode, e.Response), e.Response}
+}
+
+// classifyStravaError maps a Strava API error response to one of the Err*
+// sentinels based on the HTTP status code and the first StravaError's
+// Resource/Code pair, mirroring the hand-rolled dispatch Authorize already
+// performed for "Application" and "RequestToken" resources.
+func classifyStravaError(statusCode int, resp StravaErrorResponse) error {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case statusCode == http.StatusUnauthorized:
+		return ErrTokenExpired
+	case len(resp.Errors) > 0 && resp.Errors[0].Resource == "Application":
+		return ErrInvalidCredentials
+	case len(resp.Errors) > 0 && resp.Errors[0].Resource == "RequestToken":
+		return ErrInvalidCode
+	case len(resp.Errors) > 0 && resp.Errors[0].Code == "missing":
+		return ErrInsufficientScope
+	default:
+		return resp
+	}
+}
+
+// newStravaAPIError builds a StravaAPIError from a non-2xx response and its
+// already-read body.
+func newStravaAPIError(resp *http.Response, contents []byte) *StravaAPIError {
+	var errResp StravaErrorResponse
+	json.Unmarshal(contents, &errResp)
+
+	return &StravaAPIError{
+		StatusCode: resp.StatusCode,
+		Response:   errResp,
+		RateLimit:  parseRateLimit(resp),
+	}
+}
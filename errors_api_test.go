@@ -0,0 +1,102 @@
+package strava
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestStravaErrorResponseError(t *testing.T) {
+	resp := StravaErrorResponse{
+		Message: "Bad Request",
+		Errors: []StravaError{
+			{Resource: "Application", Field: "client_secret", Code: "invalid"},
+		},
+	}
+
+	got := resp.Error()
+	want := "strava: Bad Request: Application client_secret invalid"
+	if got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestClassifyStravaError(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		resp       StravaErrorResponse
+		want       error
+	}{
+		{"rate limited", http.StatusTooManyRequests, StravaErrorResponse{}, ErrRateLimited},
+		{"expired token", http.StatusUnauthorized, StravaErrorResponse{}, ErrTokenExpired},
+		{"bad credentials", http.StatusBadRequest, StravaErrorResponse{Errors: []StravaError{{Resource: "Application"}}}, ErrInvalidCredentials},
+		{"invalid code", http.StatusBadRequest, StravaErrorResponse{Errors: []StravaError{{Resource: "RequestToken"}}}, ErrInvalidCode},
+		{"missing scope", http.StatusBadRequest, StravaErrorResponse{Errors: []StravaError{{Code: "missing"}}}, ErrInsufficientScope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyStravaError(tt.statusCode, tt.resp)
+			if !errors.Is(got, tt.want) {
+				t.Errorf("classifyStravaError() = %v, want errors.Is match for %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStravaAPIErrorUnwrapsToSentinelAndResponse(t *testing.T) {
+	resp := StravaErrorResponse{Errors: []StravaError{{Resource: "RequestToken", Code: "used"}}}
+	apiErr := &StravaAPIError{StatusCode: http.StatusBadRequest, Response: resp}
+
+	if !errors.Is(apiErr, ErrInvalidCode) {
+		t.Error("expected errors.Is to match ErrInvalidCode")
+	}
+
+	var got StravaErrorResponse
+	if !errors.As(apiErr, &got) {
+		t.Fatal("expected errors.As to match StravaErrorResponse")
+	}
+	if got.Errors[0].Code != "used" {
+		t.Errorf("unwrapped StravaErrorResponse.Errors[0].Code = %q, want used", got.Errors[0].Code)
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	resp := &http.Response{Header: http.Header{
+		"X-Ratelimit-Limit": {"600,30000"},
+		"X-Ratelimit-Usage": {"300,5000"},
+	}}
+
+	rl := parseRateLimit(resp)
+	if rl == nil {
+		t.Fatal("expected a non-nil RateLimit")
+	}
+	if rl.ShortTermLimit != 600 || rl.DailyLimit != 30000 {
+		t.Errorf("limits = %d,%d want 600,30000", rl.ShortTermLimit, rl.DailyLimit)
+	}
+	if rl.ShortTermUsage != 300 || rl.DailyUsage != 5000 {
+		t.Errorf("usage = %d,%d want 300,5000", rl.ShortTermUsage, rl.DailyUsage)
+	}
+}
+
+func TestParseRateLimitAbsent(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	if rl := parseRateLimit(resp); rl != nil {
+		t.Errorf("parseRateLimit() = %+v, want nil", rl)
+	}
+}
+
+func TestRecordRateLimitUpdatesLastRateLimit(t *testing.T) {
+	resp := &http.Response{Header: http.Header{
+		"X-Ratelimit-Limit": {"600,30000"},
+		"X-Ratelimit-Usage": {"1,2"},
+	}}
+
+	recordRateLimit(resp)
+
+	rl := LastRateLimit()
+	if rl == nil || rl.ShortTermUsage != 1 || rl.DailyUsage != 2 {
+		t.Errorf("LastRateLimit() = %+v, want usage 1,2", rl)
+	}
+}
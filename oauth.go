@@ -1,6 +1,7 @@
 package strava
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -20,6 +21,19 @@ type OAuthAuthenticator struct {
 	// can be used to create a client using the incoming request, for Example:
 	//    func(r *http.Request) { return urlfetch.Client(appengine.NewContext(r)) }
 	RequestClientGenerator func(r *http.Request) *http.Client
+
+	// StateStore, when set, replaces the raw "state" query parameter with a
+	// signed, single-use, expiring token: AuthorizationURL issues one and
+	// HandlerFunc consumes it before invoking success, rejecting mismatched
+	// or replayed values with OAuthInvalidStateErr. When nil, state is
+	// passed through verbatim, preserving the previous behavior.
+	StateStore StateStore
+
+	// RetryPolicy controls the backoff used by Authorize / AuthorizeContext
+	// when the token endpoint fails with a network error, a 429, or a 5xx
+	// response. nil means DefaultRetryPolicy; to disable retries entirely,
+	// set it to &RetryPolicy{MaxRetries: 0}.
+	RetryPolicy *RetryPolicy
 }
 
 // Permission represents the access of an access_token.
@@ -79,8 +93,19 @@ func (auth OAuthAuthenticator) CallbackPath() (string, error) {
 	return url.Path, nil
 }
 
-// ExchangeToken handles the common logic for token exchange with the Strava API
+// ExchangeToken handles the common logic for token exchange with the Strava API,
+// retrying on network errors, 429s, and 5xx responses per DefaultRetryPolicy.
+// values carries the grant-specific parameters, e.g. {"code": ...} for the
+// initial authorization_code exchange or {"grant_type": {"refresh_token"},
+// "refresh_token": ...} for a refresh (see RefreshingTokenSource); client_id
+// and client_secret are added automatically. Use ExchangeTokenContext to
+// customize the RetryPolicy or make the exchange cancelable.
 func ExchangeToken(values url.Values) (*AuthorizationResponse, *http.Response, error) {
+	return ExchangeTokenContext(context.Background(), values, DefaultRetryPolicy)
+}
+
+// exchangeTokenOnce performs a single, non-retrying token exchange attempt.
+func exchangeTokenOnce(values url.Values) (*AuthorizationResponse, *http.Response, error) {
 	// Append client_id and client_secret to the request
 	values.Set("client_id", fmt.Sprintf("%d", ClientId))
 	values.Set("client_secret", ClientSecret)
@@ -96,12 +121,11 @@ func ExchangeToken(values url.Values) (*AuthorizationResponse, *http.Response, e
 
 	// Read the response body
 	contents, _ := io.ReadAll(resp.Body)
+	recordRateLimit(resp)
 
 	// if status code is not 200, then something went wrong
 	if resp.StatusCode/100 != 2 {
-		var stravaErr StravaErrorResponse
-		json.Unmarshal(contents, &stravaErr)
-		return nil, resp, errors.New("Strava API error")
+		return nil, resp, newStravaAPIError(resp, contents)
 	}
 
 	// Parse the response body
@@ -117,13 +141,17 @@ func ExchangeToken(values url.Values) (*AuthorizationResponse, *http.Response, e
 
 // Authorize performs the second part of the OAuth exchange. The client has already been redirected to the
 // Strava authorization page, has granted authorization to the application and has been redirected back to the
-// defined URL. The code param was returned as a query string param in to the redirect_url.
+// defined URL. The code param was returned as a query string param in to the redirect_url. Network errors, 429s,
+// and 5xx responses are retried per auth.RetryPolicy (DefaultRetryPolicy when unset); use AuthorizeContext to
+// make the exchange cancelable.
 func (auth OAuthAuthenticator) Authorize(code string, client *http.Client) (*AuthorizationResponse, error) {
-	// make sure a code was passed
-	if code == "" {
-		return nil, OAuthInvalidCodeErr
-	}
+	return auth.AuthorizeContext(context.Background(), code, client)
+}
 
+// authorizeOnce performs a single, non-retrying Authorize attempt, also
+// returning the raw *http.Response so AuthorizeContext can decide whether
+// the attempt is worth retrying.
+func (auth OAuthAuthenticator) authorizeOnce(code string, client *http.Client) (*AuthorizationResponse, *http.Response, error) {
 	// if a client wasn't passed use the default client
 	if client == nil {
 		client = http.DefaultClient
@@ -134,44 +162,25 @@ func (auth OAuthAuthenticator) Authorize(code string, client *http.Client) (*Aut
 
 	// this was a poor request, maybe strava servers down?
 	if err != nil {
-		return nil, err
+		return nil, resp, err
 	}
 	defer resp.Body.Close()
 
-	// check status code, could be 500, or most likely the client_secret is incorrect
-	if resp.StatusCode/100 == 5 {
-		return nil, OAuthServerErr
-	}
+	contents, _ := ioutil.ReadAll(resp.Body)
+	recordRateLimit(resp)
 
+	// check status code: could be 500, a bad client_secret, an already-used
+	// code, rate limiting, ... newStravaAPIError sorts out which.
 	if resp.StatusCode/100 != 2 {
-		var response Error
-		contents, _ := ioutil.ReadAll(resp.Body)
-		json.Unmarshal(contents, &response)
-
-		if len(response.Errors) == 0 {
-			return nil, OAuthServerErr
-		}
-
-		if response.Errors[0].Resource == "Application" {
-			return nil, OAuthInvalidCredentialsErr
-		}
-
-		if response.Errors[0].Resource == "RequestToken" {
-			return nil, OAuthInvalidCodeErr
-		}
-
-		return nil, &response
+		return nil, resp, newStravaAPIError(resp, contents)
 	}
 
 	var response AuthorizationResponse
-	contents, _ := ioutil.ReadAll(resp.Body)
-	err = json.Unmarshal(contents, &response)
-
-	if err != nil {
-		return nil, err
+	if err := json.Unmarshal(contents, &response); err != nil {
+		return nil, resp, err
 	}
 
-	return &response, nil
+	return &response, resp, nil
 }
 
 // HandlerFunc builds a http.HandlerFunc that will complete the token exchange
@@ -201,14 +210,37 @@ func (auth OAuthAuthenticator) HandlerFunc(
 			return
 		}
 
-		resp.State = r.FormValue("state")
+		state := r.FormValue("state")
+		if auth.StateStore != nil {
+			extra, err := auth.StateStore.Consume(r.Context(), state)
+			if err != nil {
+				failure(err, w, r)
+				return
+			}
+			state = extra["state"]
+		}
+
+		resp.State = state
 
 		success(resp, w, r)
 	}
 }
 
 // AuthorizationURL constructs the url a user should use to authorize this specific application.
+// If auth.StateStore is set, a signed, single-use token is always issued and
+// sent in place of state, carrying state (when non-empty) inside it; if Issue
+// fails, state is passed through verbatim.
 func (auth OAuthAuthenticator) AuthorizationURL(state string, scope Permission, force bool) string {
+	if auth.StateStore != nil {
+		var extra map[string]string
+		if state != "" {
+			extra = map[string]string{"state": state}
+		}
+		if issued, err := auth.StateStore.Issue(context.Background(), extra); err == nil {
+			state = issued
+		}
+	}
+
 	path := fmt.Sprintf("%s/oauth/authorize?client_id=%d&response_type=code&redirect_uri=%s&scope=%v", basePath, ClientId, auth.CallbackURL, scope)
 
 	if state != "" {
@@ -256,6 +288,10 @@ func (s *OAuthService) Deauthorize() *OAuthDeauthorizeCall {
 	}
 }
 
+// Do sends the deauthorization request. Whatever error Client.run returns is
+// passed through unchanged; Client.run (client.go) is where a non-2xx
+// response would be wrapped as a *StravaAPIError, not here, so Deauthorize
+// only gets typed errors once that file does.
 func (c *OAuthDeauthorizeCall) Do() error {
 	_, err := c.service.client.run("POST", "/oauth/deauthorize", nil)
 	return err
@@ -0,0 +1,151 @@
+package strava
+
+import (
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StateStore issues and validates the opaque "state" parameter used to guard
+// the OAuth authorization flow against CSRF. AuthorizationURL calls Issue to
+// mint a state value and HandlerFunc calls Consume to validate, and
+// invalidate, it before the success callback fires.
+type StateStore interface {
+	Issue(ctx context.Context, extra map[string]string) (string, error)
+	Consume(ctx context.Context, state string) (map[string]string, error)
+}
+
+// OAuthInvalidStateErr is returned by HandlerFunc when the "state" query
+// parameter is missing, malformed, expired, already used, or does not match
+// the signature produced by the configured StateStore.
+var OAuthInvalidStateErr = errors.New("oauth: state is invalid or expired")
+
+// defaultStateTTL is how long a token issued by HMACStateStore remains valid.
+const defaultStateTTL = 10 * time.Minute
+
+// defaultMaxSeenStates bounds the nonce LRU so a long-running process can't
+// grow it without limit.
+const defaultMaxSeenStates = 10000
+
+// stateClaims is the payload signed and base64url-encoded into every token
+// issued by HMACStateStore. Expiry is in Unix milliseconds, not seconds, so
+// that short TTLs (as used in tests) aren't lost to rounding.
+type stateClaims struct {
+	Nonce  string            `json:"n"`
+	Expiry int64             `json:"e"`
+	Extra  map[string]string `json:"x,omitempty"`
+}
+
+// HMACStateStore is the default StateStore. Issue encodes a random 128-bit
+// nonce, an expiry, and any extra data into a token signed with
+// HMAC-SHA256, and Consume keeps a bounded LRU of the nonces it has already
+// redeemed so every token can only be used once.
+type HMACStateStore struct {
+	Secret  []byte
+	TTL     time.Duration // defaults to 10 minutes when zero
+	MaxSeen int           // defaults to 10000 when zero
+
+	mu      sync.Mutex
+	seen    *list.List
+	seenSet map[string]*list.Element
+}
+
+// NewHMACStateStore builds an HMACStateStore keyed by secret.
+func NewHMACStateStore(secret []byte) *HMACStateStore {
+	return &HMACStateStore{
+		Secret:  secret,
+		seen:    list.New(),
+		seenSet: make(map[string]*list.Element),
+	}
+}
+
+func (s *HMACStateStore) Issue(ctx context.Context, extra map[string]string) (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	ttl := s.TTL
+	if ttl == 0 {
+		ttl = defaultStateTTL
+	}
+
+	payload, err := json.Marshal(stateClaims{
+		Nonce:  base64.RawURLEncoding.EncodeToString(nonce),
+		Expiry: time.Now().Add(ttl).UnixMilli(),
+		Extra:  extra,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(s.sign(payload)), nil
+}
+
+func (s *HMACStateStore) Consume(ctx context.Context, state string) (map[string]string, error) {
+	parts := strings.SplitN(state, ".", 2)
+	if len(parts) != 2 {
+		return nil, OAuthInvalidStateErr
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, OAuthInvalidStateErr
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, OAuthInvalidStateErr
+	}
+
+	if !hmac.Equal(sig, s.sign(payload)) {
+		return nil, OAuthInvalidStateErr
+	}
+
+	var claims stateClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, OAuthInvalidStateErr
+	}
+
+	if time.Now().UnixMilli() > claims.Expiry {
+		return nil, OAuthInvalidStateErr
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.seenSet[claims.Nonce]; ok {
+		return nil, OAuthInvalidStateErr
+	}
+	s.markSeenLocked(claims.Nonce)
+
+	return claims.Extra, nil
+}
+
+func (s *HMACStateStore) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func (s *HMACStateStore) markSeenLocked(nonce string) {
+	maxSeen := s.MaxSeen
+	if maxSeen == 0 {
+		maxSeen = defaultMaxSeenStates
+	}
+
+	s.seenSet[nonce] = s.seen.PushBack(nonce)
+	for s.seen.Len() > maxSeen {
+		oldest := s.seen.Front()
+		s.seen.Remove(oldest)
+		delete(s.seenSet, oldest.Value.(string))
+	}
+}
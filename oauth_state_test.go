@@ -0,0 +1,71 @@
+package strava
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHMACStateStoreRoundTrip(t *testing.T) {
+	store := NewHMACStateStore([]byte("secret"))
+
+	token, err := store.Issue(context.Background(), map[string]string{"state": "return-to-home"})
+	if err != nil {
+		t.Fatalf("Issue() error: %v", err)
+	}
+
+	extra, err := store.Consume(context.Background(), token)
+	if err != nil {
+		t.Fatalf("Consume() error: %v", err)
+	}
+	if extra["state"] != "return-to-home" {
+		t.Errorf("extra[state] = %q, want return-to-home", extra["state"])
+	}
+}
+
+func TestHMACStateStoreRejectsReplay(t *testing.T) {
+	store := NewHMACStateStore([]byte("secret"))
+
+	token, err := store.Issue(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Issue() error: %v", err)
+	}
+
+	if _, err := store.Consume(context.Background(), token); err != nil {
+		t.Fatalf("first Consume() error: %v", err)
+	}
+
+	if _, err := store.Consume(context.Background(), token); err != OAuthInvalidStateErr {
+		t.Errorf("second Consume() error = %v, want OAuthInvalidStateErr", err)
+	}
+}
+
+func TestHMACStateStoreRejectsExpired(t *testing.T) {
+	store := NewHMACStateStore([]byte("secret"))
+	store.TTL = time.Millisecond
+
+	token, err := store.Issue(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Issue() error: %v", err)
+	}
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := store.Consume(context.Background(), token); err != OAuthInvalidStateErr {
+		t.Errorf("Consume() error = %v, want OAuthInvalidStateErr", err)
+	}
+}
+
+func TestHMACStateStoreRejectsTamperedSignature(t *testing.T) {
+	store := NewHMACStateStore([]byte("secret"))
+	other := NewHMACStateStore([]byte("different-secret"))
+
+	token, err := store.Issue(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("Issue() error: %v", err)
+	}
+
+	if _, err := other.Consume(context.Background(), token); err != OAuthInvalidStateErr {
+		t.Errorf("Consume() error = %v, want OAuthInvalidStateErr", err)
+	}
+}
@@ -0,0 +1,158 @@
+package strava
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy configures the full-jitter exponential backoff used by
+// ExchangeTokenContext and AuthorizeContext when the Strava token endpoint
+// fails with a network error, a 429, or a 5xx response.
+type RetryPolicy struct {
+	MaxRetries          int
+	InitialInterval     time.Duration
+	MaxInterval         time.Duration
+	Multiplier          float64
+	RandomizationFactor float64 // 0 disables jitter; 1 is full jitter
+}
+
+// DefaultRetryPolicy is used by ExchangeToken and, when auth.RetryPolicy is
+// nil, by OAuthAuthenticator.Authorize / AuthorizeContext.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:          3,
+	InitialInterval:     500 * time.Millisecond,
+	MaxInterval:         10 * time.Second,
+	Multiplier:          2,
+	RandomizationFactor: 1,
+}
+
+// backoff returns the delay before the given retry attempt (0-indexed):
+// rand(0, min(MaxInterval, InitialInterval * Multiplier^attempt)).
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(attempt))
+	if max := float64(p.MaxInterval); p.MaxInterval > 0 && delay > max {
+		delay = max
+	}
+	if p.RandomizationFactor <= 0 {
+		return time.Duration(delay)
+	}
+	return time.Duration(rand.Float64() * p.RandomizationFactor * delay)
+}
+
+// shouldRetryTokenRequest reports whether a token-endpoint attempt should be
+// retried: any network error (no response at all), a 429, or a 5xx response.
+// Other 4xx responses (bad client_secret, invalid/used code, ...) are not
+// retried even though they surface as a non-nil err.
+func shouldRetryTokenRequest(resp *http.Response, err error) bool {
+	if resp != nil {
+		return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5
+	}
+	return err != nil
+}
+
+// retryAfter parses a Retry-After header as either delta-seconds or an
+// HTTP-date, returning ok=false when absent or unparseable.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	if when, err := http.ParseTime(v); err == nil {
+		return time.Until(when), true
+	}
+	return 0, false
+}
+
+// waitToRetry blocks for delay or until ctx is canceled, whichever comes first.
+func waitToRetry(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+// ExchangeTokenContext behaves like ExchangeToken but retries on network
+// errors, 429s (honoring a Retry-After header when present), and 5xx
+// responses according to policy, and can be canceled via ctx between
+// attempts. Pass DefaultRetryPolicy for the same behavior as ExchangeToken,
+// or a RetryPolicy with MaxRetries: 0 to disable retries entirely.
+func ExchangeTokenContext(ctx context.Context, values url.Values, policy RetryPolicy) (*AuthorizationResponse, *http.Response, error) {
+	var (
+		response *AuthorizationResponse
+		resp     *http.Response
+		err      error
+	)
+
+	for attempt := 0; ; attempt++ {
+		response, resp, err = exchangeTokenOnce(values)
+
+		if !shouldRetryTokenRequest(resp, err) || attempt >= policy.MaxRetries {
+			return response, resp, err
+		}
+
+		delay, ok := retryAfter(resp)
+		if !ok {
+			delay = policy.backoff(attempt)
+		}
+
+		if waitErr := waitToRetry(ctx, delay); waitErr != nil {
+			return response, resp, waitErr
+		}
+	}
+}
+
+// AuthorizeContext behaves like Authorize but retries on network errors,
+// 429s (honoring a Retry-After header when present), and 5xx responses
+// according to auth.RetryPolicy (DefaultRetryPolicy when nil), and can be
+// canceled via ctx between attempts.
+func (auth OAuthAuthenticator) AuthorizeContext(ctx context.Context, code string, client *http.Client) (*AuthorizationResponse, error) {
+	if code == "" {
+		return nil, OAuthInvalidCodeErr
+	}
+
+	policy := DefaultRetryPolicy
+	if auth.RetryPolicy != nil {
+		policy = *auth.RetryPolicy
+	}
+
+	var (
+		response *AuthorizationResponse
+		err      error
+	)
+
+	for attempt := 0; ; attempt++ {
+		var resp *http.Response
+		response, resp, err = auth.authorizeOnce(code, client)
+
+		if !shouldRetryTokenRequest(resp, err) || attempt >= policy.MaxRetries {
+			return response, err
+		}
+
+		delay, ok := retryAfter(resp)
+		if !ok {
+			delay = policy.backoff(attempt)
+		}
+
+		if waitErr := waitToRetry(ctx, delay); waitErr != nil {
+			return response, waitErr
+		}
+	}
+}
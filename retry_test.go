@@ -0,0 +1,186 @@
+package strava
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sequenceRoundTripper is a http.RoundTripper stub that returns a fixed
+// sequence of canned responses, one per call, repeating the last one if
+// called more times than the sequence holds.
+type sequenceRoundTripper struct {
+	mu        sync.Mutex
+	responses []func(*http.Request) (*http.Response, error)
+	calls     []time.Time
+}
+
+func (t *sequenceRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.calls = append(t.calls, time.Now())
+
+	i := len(t.calls) - 1
+	if i >= len(t.responses) {
+		i = len(t.responses) - 1
+	}
+	return t.responses[i](r)
+}
+
+func stubResponse(status int, body string, headers map[string]string) func(*http.Request) (*http.Response, error) {
+	return func(r *http.Request) (*http.Response, error) {
+		h := make(http.Header)
+		for k, v := range headers {
+			h.Set(k, v)
+		}
+		return &http.Response{
+			StatusCode: status,
+			Header:     h,
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	}
+}
+
+func withStubBasePath(t *testing.T) {
+	old := basePath
+	basePath = "http://stub.invalid"
+	t.Cleanup(func() { basePath = old })
+}
+
+var fastRetryPolicy = RetryPolicy{
+	MaxRetries:          5,
+	InitialInterval:     time.Millisecond,
+	MaxInterval:         5 * time.Millisecond,
+	Multiplier:          2,
+	RandomizationFactor: 1,
+}
+
+func TestExchangeTokenContextRetriesOn503ThenSucceeds(t *testing.T) {
+	withStubBasePath(t)
+
+	transport := &sequenceRoundTripper{responses: []func(*http.Request) (*http.Response, error){
+		stubResponse(503, "", nil),
+		stubResponse(503, "", nil),
+		stubResponse(200, `{"access_token":"abc","expires_at":1234}`, nil),
+	}}
+
+	old := http.DefaultClient.Transport
+	http.DefaultClient.Transport = transport
+	t.Cleanup(func() { http.DefaultClient.Transport = old })
+
+	start := time.Now()
+	resp, _, err := ExchangeTokenContext(context.Background(), url.Values{"code": {"abc"}}, fastRetryPolicy)
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("ExchangeTokenContext() error: %v", err)
+	}
+	if resp.AccessToken != "abc" {
+		t.Errorf("AccessToken = %q, want abc", resp.AccessToken)
+	}
+	if len(transport.calls) != 3 {
+		t.Errorf("calls = %d, want 3", len(transport.calls))
+	}
+	if elapsed > 200*time.Millisecond {
+		t.Errorf("elapsed = %v, want well under 200ms given millisecond-scale backoff", elapsed)
+	}
+}
+
+func TestExchangeTokenContextHonorsRetryAfterHeader(t *testing.T) {
+	withStubBasePath(t)
+
+	transport := &sequenceRoundTripper{responses: []func(*http.Request) (*http.Response, error){
+		stubResponse(429, "", map[string]string{"Retry-After": "0"}),
+		stubResponse(200, `{"access_token":"abc","expires_at":1234}`, nil),
+	}}
+
+	old := http.DefaultClient.Transport
+	http.DefaultClient.Transport = transport
+	t.Cleanup(func() { http.DefaultClient.Transport = old })
+
+	slowPolicy := RetryPolicy{MaxRetries: 3, InitialInterval: time.Second, MaxInterval: time.Second, Multiplier: 2, RandomizationFactor: 1}
+
+	start := time.Now()
+	_, _, err := ExchangeTokenContext(context.Background(), url.Values{"code": {"abc"}}, slowPolicy)
+	elapsed := time.Since(start)
+
+	if err != nil {
+		t.Fatalf("ExchangeTokenContext() error: %v", err)
+	}
+	if elapsed > 200*time.Millisecond {
+		t.Errorf("elapsed = %v, want well under the 1s backoff interval since Retry-After: 0 overrode it", elapsed)
+	}
+}
+
+func TestAuthorizeContextRetriesOn5xx(t *testing.T) {
+	withStubBasePath(t)
+
+	transport := &sequenceRoundTripper{responses: []func(*http.Request) (*http.Response, error){
+		stubResponse(503, "", nil),
+		stubResponse(503, "", nil),
+		stubResponse(200, `{"access_token":"abc"}`, nil),
+	}}
+	client := &http.Client{Transport: transport}
+
+	auth := OAuthAuthenticator{RetryPolicy: &fastRetryPolicy}
+
+	resp, err := auth.AuthorizeContext(context.Background(), "code123", client)
+	if err != nil {
+		t.Fatalf("AuthorizeContext() error: %v", err)
+	}
+	if resp.AccessToken != "abc" {
+		t.Errorf("AccessToken = %q, want abc", resp.AccessToken)
+	}
+	if len(transport.calls) != 3 {
+		t.Errorf("calls = %d, want 3", len(transport.calls))
+	}
+}
+
+func TestAuthorizeContextDoesNotRetryNonRetriable4xx(t *testing.T) {
+	withStubBasePath(t)
+
+	transport := &sequenceRoundTripper{responses: []func(*http.Request) (*http.Response, error){
+		stubResponse(400, `{"errors":[{"resource":"Application","field":"client_secret","code":"invalid"}]}`, nil),
+		stubResponse(200, `{"access_token":"abc"}`, nil),
+	}}
+	client := &http.Client{Transport: transport}
+
+	_, err := (OAuthAuthenticator{}).AuthorizeContext(context.Background(), "code123", client)
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("err = %v, want ErrInvalidCredentials", err)
+	}
+	if len(transport.calls) != 1 {
+		t.Errorf("calls = %d, want 1 (no retry on a non-429 4xx)", len(transport.calls))
+	}
+}
+
+func TestAuthorizeContextExplicitNoRetryPolicyIsHonored(t *testing.T) {
+	withStubBasePath(t)
+
+	transport := &sequenceRoundTripper{responses: []func(*http.Request) (*http.Response, error){
+		stubResponse(503, "", nil),
+		stubResponse(200, `{"access_token":"abc"}`, nil),
+	}}
+	client := &http.Client{Transport: transport}
+
+	// MaxRetries: 0 is how a caller says "never retry" and must not be
+	// silently upgraded to DefaultRetryPolicy.
+	noRetry := RetryPolicy{MaxRetries: 0}
+	auth := OAuthAuthenticator{RetryPolicy: &noRetry}
+
+	_, err := auth.AuthorizeContext(context.Background(), "code123", client)
+	var apiErr *StravaAPIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("err = %v, want a *StravaAPIError with StatusCode 503", err)
+	}
+	if len(transport.calls) != 1 {
+		t.Errorf("calls = %d, want exactly 1 (MaxRetries: 0 must mean no retries)", len(transport.calls))
+	}
+}
@@ -0,0 +1,214 @@
+package strava
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ErrWebhookVerifyTokenMismatch is passed to onError by WebhookHandler when
+// a subscription validation request's hub.verify_token does not match the
+// token the handler was configured with.
+var ErrWebhookVerifyTokenMismatch = errors.New("strava: webhook hub.verify_token mismatch")
+
+// Subscription represents a push subscription registered for this
+// application against the Strava Webhook Events API.
+type Subscription struct {
+	Id            int64  `json:"id"`
+	ApplicationId int64  `json:"application_id"`
+	CallbackURL   string `json:"callback_url"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
+}
+
+// WebhookEvent is a single push event delivered by Strava to a subscription's
+// callback URL.
+type WebhookEvent struct {
+	ObjectType     string            `json:"object_type"`
+	ObjectId       int64             `json:"object_id"`
+	AspectType     string            `json:"aspect_type"`
+	OwnerId        int64             `json:"owner_id"`
+	SubscriptionId int64             `json:"subscription_id"`
+	EventTime      int64             `json:"event_time"`
+	Updates        map[string]string `json:"updates"`
+}
+
+/*********************************************************/
+
+// SubscriptionsService exposes the Strava Webhook Events API
+// (/api/v3/push_subscriptions): creating, listing, and deleting push
+// subscriptions, and serving the subscription handshake and event delivery
+// over HTTP via WebhookHandler.
+type SubscriptionsService struct {
+	client *Client
+}
+
+func NewSubscriptionsService(client *Client) *SubscriptionsService {
+	return &SubscriptionsService{client}
+}
+
+type SubscriptionsCreateCall struct {
+	service     *SubscriptionsService
+	callbackURL string
+	verifyToken string
+}
+
+func (s *SubscriptionsService) Create(callbackURL, verifyToken string) *SubscriptionsCreateCall {
+	return &SubscriptionsCreateCall{
+		service:     s,
+		callbackURL: callbackURL,
+		verifyToken: verifyToken,
+	}
+}
+
+func (c *SubscriptionsCreateCall) Do() (*Subscription, error) {
+	resp, err := c.service.client.run("POST", "/push_subscriptions", url.Values{
+		"callback_url": {c.callbackURL},
+		"verify_token": {c.verifyToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var subscription Subscription
+	if err := json.NewDecoder(resp.Body).Decode(&subscription); err != nil {
+		return nil, err
+	}
+
+	return &subscription, nil
+}
+
+type SubscriptionsListCall struct {
+	service *SubscriptionsService
+}
+
+func (s *SubscriptionsService) List() *SubscriptionsListCall {
+	return &SubscriptionsListCall{service: s}
+}
+
+func (c *SubscriptionsListCall) Do() ([]*Subscription, error) {
+	resp, err := c.service.client.run("GET", "/push_subscriptions", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var subscriptions []*Subscription
+	if err := json.NewDecoder(resp.Body).Decode(&subscriptions); err != nil {
+		return nil, err
+	}
+
+	return subscriptions, nil
+}
+
+type SubscriptionsDeleteCall struct {
+	service *SubscriptionsService
+	id      int64
+}
+
+func (s *SubscriptionsService) Delete(id int64) *SubscriptionsDeleteCall {
+	return &SubscriptionsDeleteCall{
+		service: s,
+		id:      id,
+	}
+}
+
+func (c *SubscriptionsDeleteCall) Do() error {
+	_, err := c.service.client.run("DELETE", fmt.Sprintf("/push_subscriptions/%d", c.id), nil)
+	return err
+}
+
+// maxOverflowGoroutinesPerWorker bounds the number of extra goroutines
+// WebhookHandler will spawn, beyond its worker pool, to hold an event that
+// arrived while the event queue was full. This keeps a sustained burst from
+// Strava bounded in goroutines and memory. Once all of them are in use, the
+// handler does not return until the event is queued, and net/http does not
+// complete the response to Strava before then.
+const maxOverflowGoroutinesPerWorker = 4
+
+// WebhookHandler builds a http.HandlerFunc that serves both halves of the
+// Strava Webhook Events API against a single callback URL: the GET
+// subscription validation handshake (echoing hub.challenge once hub.mode and
+// hub.verify_token check out) and the POST event delivery callback. Strava
+// requires a 200 within 2 seconds of delivery, so the handler writes the 200
+// status before dispatching and dispatches onEvent on a pool of workers
+// goroutines rather than processing events inline; workers defaults to 1
+// when <= 0. A bounded number of additional goroutines (see
+// maxOverflowGoroutinesPerWorker) absorb bursts beyond that pool; once that
+// overflow capacity is also exhausted, the handler blocks until the event
+// queue has room, and the response is not completed until it returns.
+// onError is called for a
+// handshake mismatch (ErrWebhookVerifyTokenMismatch) or an event body that
+// fails to decode.
+func (s *SubscriptionsService) WebhookHandler(
+	verifyToken string,
+	workers int,
+	onEvent func(ctx context.Context, event *WebhookEvent),
+	onError func(err error, w http.ResponseWriter, r *http.Request)) http.HandlerFunc {
+
+	if workers <= 0 {
+		workers = 1
+	}
+
+	events := make(chan *WebhookEvent, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for event := range events {
+				onEvent(context.Background(), event)
+			}
+		}()
+	}
+
+	overflow := make(chan struct{}, workers*maxOverflowGoroutinesPerWorker)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			query := r.URL.Query()
+
+			tokenOK := subtle.ConstantTimeCompare([]byte(query.Get("hub.verify_token")), []byte(verifyToken)) == 1
+			if query.Get("hub.mode") != "subscribe" || !tokenOK {
+				onError(ErrWebhookVerifyTokenMismatch, w, r)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"hub.challenge": query.Get("hub.challenge")})
+			return
+		}
+
+		var event WebhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			onError(err, w, r)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		// events is buffered to `workers` deep; if that buffer is full, hand
+		// off on a bounded overflow goroutine rather than block the response
+		// that Strava is waiting 2 seconds for. If overflow capacity is also
+		// exhausted, block here instead of spawning yet another goroutine;
+		// net/http completes the response only when this handler returns,
+		// so Strava waits for the event to be queued too.
+		select {
+		case events <- &event:
+			return
+		default:
+		}
+
+		select {
+		case overflow <- struct{}{}:
+			go func() {
+				defer func() { <-overflow }()
+				events <- &event
+			}()
+		default:
+			events <- &event
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package strava
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionsCreate(t *testing.T) {
+	client := newCassetteClient(testToken, "subscription_create")
+	subscription, err := NewSubscriptionsService(client).Create("https://example.com/callback", "verify-me").Do()
+
+	if err != nil {
+		t.Fatalf("service error: %v", err)
+	}
+
+	if subscription.CallbackURL != "https://example.com/callback" {
+		t.Errorf("callback url incorrect, got %v", subscription.CallbackURL)
+	}
+
+	// from here on out just check the request parameters
+	s := NewSubscriptionsService(newStoreRequestClient())
+
+	s.Create("https://example.com/callback", "verify-me").Do()
+
+	transport := s.client.httpClient.Transport.(*storeRequestTransport)
+	if transport.request.URL.Path != "/api/v3/push_subscriptions" {
+		t.Errorf("request path incorrect, got %v", transport.request.URL.Path)
+	}
+	if transport.request.Method != "POST" {
+		t.Errorf("request method incorrect, got %v", transport.request.Method)
+	}
+}
+
+func TestSubscriptionsList(t *testing.T) {
+	client := newCassetteClient(testToken, "subscription_list")
+	subscriptions, err := NewSubscriptionsService(client).List().Do()
+
+	if err != nil {
+		t.Fatalf("service error: %v", err)
+	}
+
+	if len(subscriptions) == 0 {
+		t.Fatal("subscriptions not parsed")
+	}
+
+	// from here on out just check the request parameters
+	s := NewSubscriptionsService(newStoreRequestClient())
+
+	s.List().Do()
+
+	transport := s.client.httpClient.Transport.(*storeRequestTransport)
+	if transport.request.URL.Path != "/api/v3/push_subscriptions" {
+		t.Errorf("request path incorrect, got %v", transport.request.URL.Path)
+	}
+	if transport.request.Method != "GET" {
+		t.Errorf("request method incorrect, got %v", transport.request.Method)
+	}
+}
+
+func TestSubscriptionsDelete(t *testing.T) {
+	client := newCassetteClient(testToken, "subscription_delete")
+	err := NewSubscriptionsService(client).Delete(123).Do()
+
+	if err != nil {
+		t.Fatalf("service error: %v", err)
+	}
+
+	// from here on out just check the request parameters
+	s := NewSubscriptionsService(newStoreRequestClient())
+
+	s.Delete(456).Do()
+
+	transport := s.client.httpClient.Transport.(*storeRequestTransport)
+	if transport.request.URL.Path != "/api/v3/push_subscriptions/456" {
+		t.Errorf("request path incorrect, got %v", transport.request.URL.Path)
+	}
+	if transport.request.Method != "DELETE" {
+		t.Errorf("request method incorrect, got %v", transport.request.Method)
+	}
+}
+
+func TestWebhookHandlerValidatesSubscription(t *testing.T) {
+	handler := NewSubscriptionsService(nil).WebhookHandler("my-verify-token", 1,
+		func(ctx context.Context, event *WebhookEvent) {},
+		func(err error, w http.ResponseWriter, r *http.Request) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+		})
+
+	req := httptest.NewRequest(http.MethodGet, "/webhook?"+url.Values{
+		"hub.mode":         {"subscribe"},
+		"hub.verify_token": {"my-verify-token"},
+		"hub.challenge":    {"some-challenge"},
+	}.Encode(), nil)
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+
+	var body map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("bad response body: %v", err)
+	}
+	if body["hub.challenge"] != "some-challenge" {
+		t.Errorf("hub.challenge = %q, want some-challenge", body["hub.challenge"])
+	}
+}
+
+func TestWebhookHandlerRejectsBadVerifyToken(t *testing.T) {
+	var onErrorCalled bool
+	handler := NewSubscriptionsService(nil).WebhookHandler("my-verify-token", 1,
+		func(ctx context.Context, event *WebhookEvent) {},
+		func(err error, w http.ResponseWriter, r *http.Request) {
+			onErrorCalled = true
+			if err != ErrWebhookVerifyTokenMismatch {
+				t.Errorf("err = %v, want ErrWebhookVerifyTokenMismatch", err)
+			}
+			http.Error(w, err.Error(), http.StatusForbidden)
+		})
+
+	req := httptest.NewRequest(http.MethodGet, "/webhook?"+url.Values{
+		"hub.mode":         {"subscribe"},
+		"hub.verify_token": {"wrong-token"},
+		"hub.challenge":    {"some-challenge"},
+	}.Encode(), nil)
+	w := httptest.NewRecorder()
+
+	handler(w, req)
+
+	if !onErrorCalled {
+		t.Error("onError was not called for a verify_token mismatch")
+	}
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want 403", w.Code)
+	}
+}
+
+func TestWebhookHandlerDispatchesEvents(t *testing.T) {
+	var mu sync.Mutex
+	var received []*WebhookEvent
+
+	handler := NewSubscriptionsService(nil).WebhookHandler("my-verify-token", 2,
+		func(ctx context.Context, event *WebhookEvent) {
+			mu.Lock()
+			defer mu.Unlock()
+			received = append(received, event)
+		},
+		func(err error, w http.ResponseWriter, r *http.Request) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		})
+
+	body := `{"object_type":"activity","object_id":987,"aspect_type":"create","owner_id":5,"subscription_id":1,"event_time":1600000000,"updates":{}}`
+	req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	start := time.Now()
+	handler(w, req)
+	elapsed := time.Since(start)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if elapsed > 100*time.Millisecond {
+		t.Errorf("handler blocked for %v, want an immediate 200 per Strava's delivery SLA", elapsed)
+	}
+
+	deadline := time.After(time.Second)
+	for {
+		mu.Lock()
+		n := len(received)
+		mu.Unlock()
+		if n == 1 {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("event was never dispatched to onEvent")
+		case <-time.After(time.Millisecond):
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if received[0].ObjectId != 987 {
+		t.Errorf("ObjectId = %d, want 987", received[0].ObjectId)
+	}
+}
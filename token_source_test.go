@@ -0,0 +1,246 @@
+package strava
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func withTestBasePath(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	old := basePath
+	basePath = server.URL
+	t.Cleanup(func() { basePath = old })
+}
+
+func TestRefreshingTokenSourceRefreshesWhenExpiring(t *testing.T) {
+	var requests int32
+	withTestBasePath(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		r.ParseForm()
+
+		if got := r.FormValue("grant_type"); got != "refresh_token" {
+			t.Errorf("grant_type = %q, want refresh_token", got)
+		}
+		if got := r.FormValue("refresh_token"); got != "old-refresh" {
+			t.Errorf("refresh_token = %q, want old-refresh", got)
+		}
+
+		json.NewEncoder(w).Encode(AuthorizationResponse{
+			AccessToken:  "new-access",
+			RefreshToken: "new-refresh",
+			ExpiresAt:    time.Now().Add(time.Hour).Unix(),
+		})
+	})
+
+	store := NewMemoryTokenStore()
+	ts := NewRefreshingTokenSource(42, &AuthorizationResponse{
+		AccessToken:  "old-access",
+		RefreshToken: "old-refresh",
+		ExpiresAt:    time.Now().Add(-time.Minute).Unix(),
+	}, store)
+
+	resp, err := ts.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() error: %v", err)
+	}
+	if resp.AccessToken != "new-access" {
+		t.Errorf("AccessToken = %q, want new-access", resp.AccessToken)
+	}
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("requests = %d, want 1", requests)
+	}
+
+	stored, err := store.Load(42)
+	if err != nil {
+		t.Fatalf("store.Load() error: %v", err)
+	}
+	if stored == nil || stored.AccessToken != "new-access" {
+		t.Error("refreshed token was not persisted to the store")
+	}
+}
+
+func TestRefreshingTokenSourceReturnsCachedTokenWhenFresh(t *testing.T) {
+	var requests int32
+	withTestBasePath(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	})
+
+	ts := NewRefreshingTokenSource(1, &AuthorizationResponse{
+		AccessToken:  "still-good",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Now().Add(time.Hour).Unix(),
+	}, nil)
+
+	resp, err := ts.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() error: %v", err)
+	}
+	if resp.AccessToken != "still-good" {
+		t.Errorf("AccessToken = %q, want still-good", resp.AccessToken)
+	}
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Errorf("expected no refresh requests, got %d", requests)
+	}
+}
+
+func TestRefreshingTokenSourceSingleFlight(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+
+	withTestBasePath(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		json.NewEncoder(w).Encode(AuthorizationResponse{
+			AccessToken:  "new-access",
+			RefreshToken: "new-refresh",
+			ExpiresAt:    time.Now().Add(time.Hour).Unix(),
+		})
+	})
+
+	ts := NewRefreshingTokenSource(7, &AuthorizationResponse{
+		AccessToken:  "old-access",
+		RefreshToken: "old-refresh",
+		ExpiresAt:    time.Now().Add(-time.Minute).Unix(),
+	}, NewMemoryTokenStore())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ts.Token(context.Background()); err != nil {
+				t.Errorf("Token() error: %v", err)
+			}
+		}()
+	}
+
+	// give every goroutine a chance to observe the expiring token and join
+	// the in-flight refresh before it completes.
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if atomic.LoadInt32(&requests) != 1 {
+		t.Errorf("requests = %d, want exactly 1 in-flight refresh", requests)
+	}
+}
+
+// fakeTokenSource is a TokenSource and ForceRefresher test double that
+// serves tokens from a fixed list and records how it was called; its
+// ForceRefresh fails unless forceRefresh is set.
+type fakeTokenSource struct {
+	tokens       []string
+	forceRefresh bool
+
+	mu        sync.Mutex
+	calls     int
+	refreshed bool
+}
+
+func (f *fakeTokenSource) Token(ctx context.Context) (*AuthorizationResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i := f.calls
+	if i >= len(f.tokens) {
+		i = len(f.tokens) - 1
+	}
+	f.calls++
+	return &AuthorizationResponse{AccessToken: f.tokens[i]}, nil
+}
+
+func (f *fakeTokenSource) ForceRefresh(ctx context.Context) (*AuthorizationResponse, error) {
+	if !f.forceRefresh {
+		return nil, errors.New("ForceRefresh not supported")
+	}
+	f.mu.Lock()
+	f.refreshed = true
+	f.mu.Unlock()
+	return f.Token(ctx)
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestTokenSourceTransportRetriesOnceAfter401(t *testing.T) {
+	var gotAuth []string
+	base := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		gotAuth = append(gotAuth, r.Header.Get("Authorization"))
+		if len(gotAuth) == 1 {
+			return &http.Response{StatusCode: http.StatusUnauthorized, Body: http.NoBody}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+
+	source := &fakeTokenSource{tokens: []string{"stale", "fresh"}, forceRefresh: true}
+	transport := NewTokenSourceTransport(source, base)
+
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/athlete", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+
+	if len(gotAuth) != 2 {
+		t.Fatalf("base RoundTrip called %d times, want 2 (original + one retry)", len(gotAuth))
+	}
+	if gotAuth[0] != "Bearer stale" || gotAuth[1] != "Bearer fresh" {
+		t.Errorf("Authorization headers = %v, want [Bearer stale, Bearer fresh]", gotAuth)
+	}
+	if !source.refreshed {
+		t.Error("ForceRefresh was never called after the 401")
+	}
+}
+
+func TestTokenSourceTransportDoesNotRetryASecondTime(t *testing.T) {
+	calls := 0
+	base := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		calls++
+		return &http.Response{StatusCode: http.StatusUnauthorized, Body: http.NoBody}, nil
+	})
+
+	source := &fakeTokenSource{tokens: []string{"stale", "still-stale"}, forceRefresh: true}
+	transport := NewTokenSourceTransport(source, base)
+
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/athlete", nil)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() error: %v", err)
+	}
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401 (persistent auth failure surfaces, not retried forever)", resp.StatusCode)
+	}
+	if calls != 2 {
+		t.Errorf("base RoundTrip called %d times, want exactly 2", calls)
+	}
+}
+
+func TestTokenSourceTransportLeavesOriginalRequestUntouched(t *testing.T) {
+	base := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+
+	source := &fakeTokenSource{tokens: []string{"the-token"}}
+	transport := NewTokenSourceTransport(source, base)
+
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/athlete", nil)
+	if _, err := transport.RoundTrip(req); err != nil {
+		t.Fatalf("RoundTrip() error: %v", err)
+	}
+
+	if req.Header.Get("Authorization") != "" {
+		t.Errorf("original request was mutated: Authorization = %q, want empty", req.Header.Get("Authorization"))
+	}
+}